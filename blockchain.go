@@ -66,6 +66,12 @@ func (bc *Blockchain) MineBlock(transactions []*Transaction) {
 
 		return nil
 	})
+	if err != nil {
+		fmt.Printf("Error persisting new block")
+		return
+	}
+
+	UTXOSet{bc}.Update(newBlock)
 }
 
 // BlockchainIterator is the struct defining
@@ -110,6 +116,30 @@ func (i *BlockchainIterator) Next() *Block {
 	return block
 }
 
+// GetBlock looks up and deserializes the block with the given hash,
+// regardless of whether it sits on the active branch.
+func (bc *Blockchain) GetBlock(hash []byte) (*Block, error) {
+	var block *Block
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		encodedBlock := b.Get(hash)
+		if encodedBlock == nil {
+			return fmt.Errorf("block %x not found", hash)
+		}
+
+		nblock, err := DeserializeBlock(encodedBlock)
+		if err != nil {
+			return err
+		}
+		block = nblock
+
+		return nil
+	})
+
+	return block, err
+}
+
 // FindUnspentTransactions returns a list of transactions containing unspent outputs
 func (bc *Blockchain) FindUnspentTransactions(address string) []Transaction {
 	var unspentTXs []Transaction
@@ -156,45 +186,49 @@ func (bc *Blockchain) FindUnspentTransactions(address string) []Transaction {
 	return unspentTXs
 }
 
-// FindUTXO finds and returns all unspent transaction outputs
-func (bc *Blockchain) FindUTXO(address string) []TXOutput {
-	var UTXOs []TXOutput
-	unspentTransactions := bc.FindUnspentTransactions(address)
-
-	for _, tx := range unspentTransactions {
-		for _, out := range tx.Vout {
-			if out.CanBeUnlockedWith(address) {
-				UTXOs = append(UTXOs, out)
-			}
-		}
-	}
+// FindAllUTXO finds all unspent transaction outputs across the whole
+// chain, grouped by txid. It is used to populate the chainstate bucket
+// during UTXOSet.Reindex, in place of per-address scans.
+func (bc *Blockchain) FindAllUTXO() map[string]TXOutputs {
+	UTXO := make(map[string]TXOutputs)
+	spentTXOs := make(map[string][]int)
+	bci := bc.Iterator()
 
-	return UTXOs
-}
+	for {
+		block := bci.Next()
 
-// FindSpendableOutputs finds and returns unspent outputs to reference in inputs
-func (bc *Blockchain) FindSpendableOutputs(address string, amount int) (int, map[string][]int) {
-	unspentOutputs := make(map[string][]int)
-	unspentTXs := bc.FindUnspentTransactions(address)
-	accumulated := 0
+		for _, tx := range block.Transactions {
+			txID := hex.EncodeToString(tx.ID)
 
-Work:
-	for _, tx := range unspentTXs {
-		txID := hex.EncodeToString(tx.ID)
+		Outputs:
+			for outIdx, out := range tx.Vout {
+				if spentTXOs[txID] != nil {
+					for _, spentOutIdx := range spentTXOs[txID] {
+						if spentOutIdx == outIdx {
+							continue Outputs
+						}
+					}
+				}
 
-		for outIdx, out := range tx.Vout {
-			if out.CanBeUnlockedWith(address) && accumulated < amount {
-				accumulated += out.Value
-				unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
+				outs := UTXO[txID]
+				outs.Outputs = append(outs.Outputs, out)
+				UTXO[txID] = outs
+			}
 
-				if accumulated >= amount {
-					break Work
+			if tx.IsCoinbase() == false {
+				for _, in := range tx.Vin {
+					inTxID := hex.EncodeToString(in.Txid)
+					spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Vout)
 				}
 			}
 		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
 	}
 
-	return accumulated, unspentOutputs
+	return UTXO
 }
 
 // CreateBlockchain creates a new blockchain DB
@@ -0,0 +1,267 @@
+package gcd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/boltdb/bolt"
+)
+
+// reorgTargetBits mirrors the chain's proof-of-work difficulty target,
+// used to weigh cumulative work when comparing competing branches.
+const reorgTargetBits = 24
+
+// BlockTreeNode is a single entry in the in-memory block-tree index. It
+// tracks enough information about a known block to walk branches and
+// compare cumulative work without touching the bolt DB.
+type BlockTreeNode struct {
+	Hash     []byte
+	Parent   *BlockTreeNode
+	Children []*BlockTreeNode
+	Height   int
+	WorkSum  *big.Int
+}
+
+// BlockTree indexes every block the node knows about, keyed by hash,
+// so a competing branch can be compared against and switched to
+// without rescanning the blocks bucket.
+type BlockTree struct {
+	nodes map[string]*BlockTreeNode
+}
+
+// blockWork returns the proof-of-work a single block represents.
+func blockWork() *big.Int {
+	work := big.NewInt(1)
+	return work.Lsh(work, uint(256-reorgTargetBits))
+}
+
+// NewBlockTree seeds the in-memory block-tree index by walking bc's
+// active branch from its tip back to genesis. Competing branches are
+// learned about as their blocks arrive through Server.AddBlock.
+func NewBlockTree(bc *Blockchain) *BlockTree {
+	tree := &BlockTree{nodes: make(map[string]*BlockTreeNode)}
+
+	var blocks []*Block
+	bci := bc.Iterator()
+	for {
+		block := bci.Next()
+		blocks = append(blocks, block)
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	for i := len(blocks) - 1; i >= 0; i-- {
+		tree.insert(blocks[i])
+	}
+
+	return tree
+}
+
+// insert adds block to the tree if it isn't already present, linking
+// it to its parent node when one is known.
+func (t *BlockTree) insert(block *Block) *BlockTreeNode {
+	hashStr := hex.EncodeToString(block.Hash)
+	if node, ok := t.nodes[hashStr]; ok {
+		return node
+	}
+
+	var parent *BlockTreeNode
+	if len(block.PrevBlockHash) > 0 {
+		parent = t.nodes[hex.EncodeToString(block.PrevBlockHash)]
+	}
+
+	node := &BlockTreeNode{Hash: block.Hash, Parent: parent}
+	if parent == nil {
+		node.Height = 0
+		node.WorkSum = blockWork()
+	} else {
+		node.Height = parent.Height + 1
+		node.WorkSum = new(big.Int).Add(parent.WorkSum, blockWork())
+		parent.Children = append(parent.Children, node)
+	}
+
+	t.nodes[hashStr] = node
+	return node
+}
+
+// FindFarthestNode returns the leaf node (one with no known children)
+// carrying the most cumulative work, i.e. the tip of the best known
+// chain.
+func (t *BlockTree) FindFarthestNode() *BlockTreeNode {
+	var best *BlockTreeNode
+
+	for _, node := range t.nodes {
+		if len(node.Children) > 0 {
+			continue
+		}
+		if best == nil || node.WorkSum.Cmp(best.WorkSum) > 0 {
+			best = node
+		}
+	}
+
+	return best
+}
+
+// DeleteBranch removes node and all of its descendants from the tree,
+// used when MoveToBlock fails to apply a branch so the bad branch is
+// never retried.
+func (t *BlockTree) DeleteBranch(node *BlockTreeNode) {
+	children := append([]*BlockTreeNode(nil), node.Children...)
+	for _, child := range children {
+		t.DeleteBranch(child)
+	}
+
+	delete(t.nodes, hex.EncodeToString(node.Hash))
+
+	if node.Parent != nil {
+		siblings := node.Parent.Children[:0]
+		for _, child := range node.Parent.Children {
+			if !bytes.Equal(child.Hash, node.Hash) {
+				siblings = append(siblings, child)
+			}
+		}
+		node.Parent.Children = siblings
+	}
+}
+
+// commonAncestor walks both nodes' parent chains to find the nearest
+// block they have in common.
+func commonAncestor(a, b *BlockTreeNode) *BlockTreeNode {
+	seen := make(map[string]bool)
+	for n := a; n != nil; n = n.Parent {
+		seen[hex.EncodeToString(n.Hash)] = true
+	}
+	for n := b; n != nil; n = n.Parent {
+		if seen[hex.EncodeToString(n.Hash)] {
+			return n
+		}
+	}
+
+	return nil
+}
+
+// blockTreeIndex lazily builds and caches the Server's in-memory block-tree
+// index on first use.
+func (s *Server) blockTreeIndex() *BlockTree {
+	if s.blockTree == nil {
+		s.blockTree = NewBlockTree(s.db)
+	}
+
+	return s.blockTree
+}
+
+// AddBlock inserts b into the blocks bucket and the in-memory
+// block-tree index without moving the chain tip, so a competing branch
+// can be tracked without disrupting the active chain until MoveToBlock
+// decides to switch to it.
+func (s *Server) AddBlock(b *Block) error {
+	err := s.db.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blocksBucket))
+		if bucket.Get(b.Hash) != nil {
+			return nil
+		}
+
+		serialized, err := b.SerializeBlock()
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(b.Hash, serialized)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.blockTreeIndex().insert(b)
+
+	return nil
+}
+
+// MoveToBlock reorganizes the active chain onto target: it finds the
+// common ancestor with the current tip, then walks forward along
+// target's branch, verifying every transaction in each block before
+// applying it. Once the new tip is chosen, the chainstate bucket is
+// resynced with a single utxoSet.Reindex() rather than undone and
+// replayed block by block. If a block on the target branch fails to
+// verify, its branch is deleted from the tree and the chain falls back
+// to the last block on that branch that did verify. The new tip is
+// only ever committed if it carries strictly more cumulative work than
+// the chain's tip when MoveToBlock was called — a malformed or
+// low-work candidate branch leaves the current tip untouched instead
+// of shortening it.
+func (s *Server) MoveToBlock(target *BlockTreeNode) error {
+	tree := s.blockTreeIndex()
+
+	currentNode, ok := tree.nodes[hex.EncodeToString(s.db.tip)]
+	if !ok {
+		return fmt.Errorf("current tip %x not found in block tree", s.db.tip)
+	}
+	originalWork := currentNode.WorkSum
+
+	ancestor := commonAncestor(currentNode, target)
+	if ancestor == nil {
+		return fmt.Errorf("no common ancestor between current tip and target block")
+	}
+
+	var forwardPath []*BlockTreeNode
+	for n := target; n != nil && !bytes.Equal(n.Hash, ancestor.Hash); n = n.Parent {
+		forwardPath = append([]*BlockTreeNode{n}, forwardPath...)
+	}
+
+	lastGood := ancestor
+	for _, n := range forwardPath {
+		block, err := s.db.GetBlock(n.Hash)
+		if err != nil {
+			tree.DeleteBranch(n)
+			break
+		}
+
+		verified := true
+		for _, tx := range block.Transactions {
+			if !s.db.VerifyTransaction(tx) {
+				verified = false
+				break
+			}
+		}
+		if !verified {
+			tree.DeleteBranch(n)
+			break
+		}
+
+		lastGood = n
+	}
+
+	if lastGood.WorkSum.Cmp(originalWork) <= 0 {
+		return fmt.Errorf("candidate branch work %s does not exceed current tip work %s, keeping current tip", lastGood.WorkSum, originalWork)
+	}
+
+	err := s.db.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		return b.Put([]byte("1"), lastGood.Hash)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.db.tip = lastGood.Hash
+	s.utxoSet.Reindex()
+
+	return nil
+}
+
+// HandleReceivedBlock is the block-tree entry point for the peer
+// protocol's "block" message: it records the block without disturbing
+// the active chain, then reorgs onto whichever branch now carries the
+// most cumulative work. The peer message handler's "block" case calls
+// this instead of overwriting the tip directly, so a longer competing
+// chain from a peer can replace shorter local history safely.
+func (s *Server) HandleReceivedBlock(block *Block) error {
+	if err := s.AddBlock(block); err != nil {
+		return err
+	}
+
+	return s.MoveToBlock(s.blockTreeIndex().FindFarthestNode())
+}
@@ -0,0 +1,366 @@
+package gcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+)
+
+// jsonrpcVersion is the only JSON-RPC version this server speaks.
+const jsonrpcVersion = "2.0"
+
+const (
+	jsonrpcParseError     = -32700
+	jsonrpcInvalidRequest = -32600
+	jsonrpcMethodNotFound = -32601
+	jsonrpcInvalidParams  = -32602
+	jsonrpcInternalError  = -32603
+)
+
+// jsonrpcRequest is a single JSON-RPC 2.0 request object.
+type jsonrpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      interface{}     `json:"id"`
+}
+
+// jsonrpcResponse is a single JSON-RPC 2.0 response object.
+type jsonrpcResponse struct {
+	JSONRPC string        `json:"jsonrpc"`
+	Result  interface{}   `json:"result,omitempty"`
+	Error   *jsonrpcError `json:"error,omitempty"`
+	ID      interface{}   `json:"id"`
+}
+
+// jsonrpcError is the JSON-RPC 2.0 error object.
+type jsonrpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// StartRPCServer starts the JSON-RPC 2.0 HTTP server used by wallets
+// and block explorers to query raw transactions and blocks. It is
+// shut down gracefully when quitChan closes, the same way the peer
+// listener is, so Server.Stop's wg.Wait() doesn't hang on it.
+func (s *Server) StartRPCServer() {
+	defer s.wg.Done()
+
+	if err := s.db.buildTxIndex(); err != nil {
+		log.Printf("[GCRPC] Error building tx index: %v", err)
+	}
+
+	port := s.cfg.rpcPort
+	if port == "" {
+		port = defaultRPCHostPort
+	}
+
+	s.Router.HandleFunc("/", s.handleJSONRPC).Methods("POST")
+	s.Router.HandleFunc("/tx/{txid}/proof", s.handleTxProof).Methods("GET")
+
+	s.rpcServer = &http.Server{
+		Addr:    net.JoinHostPort("", port),
+		Handler: s.Router,
+	}
+
+	go func() {
+		<-s.quitChan
+		if err := s.rpcServer.Shutdown(context.Background()); err != nil {
+			log.Printf("[GCRPC] Error shutting down RPC server: %v", err)
+		}
+	}()
+
+	log.Printf("[GCRPC] JSON-RPC server listening on port %s", port)
+	if err := s.rpcServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("[GCRPC] RPC server stopped: %v", err)
+	}
+}
+
+// handleJSONRPC dispatches a single JSON-RPC 2.0 request, or a batch of
+// them per the spec, to the matching method implementation.
+func (s *Server) handleJSONRPC(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		json.NewEncoder(w).Encode(jsonrpcResponse{JSONRPC: jsonrpcVersion, Error: &jsonrpcError{jsonrpcParseError, "parse error"}})
+		return
+	}
+
+	var batch []json.RawMessage
+	isBatch := json.Unmarshal(raw, &batch) == nil
+	if !isBatch {
+		batch = []json.RawMessage{raw}
+	} else if len(batch) == 0 {
+		json.NewEncoder(w).Encode(jsonrpcResponse{JSONRPC: jsonrpcVersion, Error: &jsonrpcError{jsonrpcInvalidRequest, "invalid request"}})
+		return
+	}
+
+	responses := make([]jsonrpcResponse, 0, len(batch))
+	for _, item := range batch {
+		responses = append(responses, s.handleSingleRPC(item))
+	}
+
+	if !isBatch {
+		json.NewEncoder(w).Encode(responses[0])
+		return
+	}
+
+	json.NewEncoder(w).Encode(responses)
+}
+
+func (s *Server) handleSingleRPC(raw json.RawMessage) jsonrpcResponse {
+	var req jsonrpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return jsonrpcResponse{JSONRPC: jsonrpcVersion, Error: &jsonrpcError{jsonrpcInvalidRequest, "invalid request"}}
+	}
+
+	resp := jsonrpcResponse{JSONRPC: jsonrpcVersion, ID: req.ID}
+
+	result, rpcErr := s.dispatchRPC(req.Method, req.Params)
+	if rpcErr != nil {
+		resp.Error = rpcErr
+	} else {
+		resp.Result = result
+	}
+
+	return resp
+}
+
+func (s *Server) dispatchRPC(method string, params json.RawMessage) (interface{}, *jsonrpcError) {
+	switch method {
+	case "getrawtransaction":
+		return s.rpcGetRawTransaction(params)
+	case "sendrawtransaction":
+		return s.rpcSendRawTransaction(params)
+	case "getblock":
+		return s.rpcGetBlock(params)
+	case "getblockhash":
+		return s.rpcGetBlockHash(params)
+	case "getblockcount":
+		return s.rpcGetBlockCount()
+	case "getmempoolinfo":
+		return s.rpcGetMempoolInfo()
+	case "getbestblockhash":
+		return s.rpcGetBestBlockHash()
+	default:
+		return nil, &jsonrpcError{jsonrpcMethodNotFound, fmt.Sprintf("method %q not found", method)}
+	}
+}
+
+type getRawTransactionParams struct {
+	TxID    string `json:"txid"`
+	Verbose bool   `json:"verbose"`
+}
+
+// rpcGetRawTransaction implements getrawtransaction, returning either
+// the hex-encoded serialized transaction or a decoded vin/vout view.
+func (s *Server) rpcGetRawTransaction(params json.RawMessage) (interface{}, *jsonrpcError) {
+	var p getRawTransactionParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &jsonrpcError{jsonrpcInvalidParams, "invalid params"}
+	}
+
+	txID, err := hex.DecodeString(p.TxID)
+	if err != nil {
+		return nil, &jsonrpcError{jsonrpcInvalidParams, "invalid txid"}
+	}
+
+	blockHash, err := s.db.LookupTxBlock(txID)
+	if err != nil {
+		return nil, &jsonrpcError{jsonrpcInvalidParams, "no such transaction"}
+	}
+
+	block, err := s.db.GetBlock(blockHash)
+	if err != nil {
+		return nil, &jsonrpcError{jsonrpcInternalError, err.Error()}
+	}
+
+	var tx *Transaction
+	for _, t := range block.Transactions {
+		if bytes.Equal(t.ID, txID) {
+			tx = t
+			break
+		}
+	}
+	if tx == nil {
+		return nil, &jsonrpcError{jsonrpcInternalError, "indexed block does not contain transaction"}
+	}
+
+	serialized, err := tx.Serialize()
+	if err != nil {
+		return nil, &jsonrpcError{jsonrpcInternalError, err.Error()}
+	}
+
+	if !p.Verbose {
+		return hex.EncodeToString(serialized), nil
+	}
+
+	return decodeTransaction(tx, blockHash), nil
+}
+
+// decodeTransaction renders a transaction's vin/vout as a JSON-friendly
+// value for verbose RPC responses.
+func decodeTransaction(tx *Transaction, blockHash []byte) map[string]interface{} {
+	vin := make([]map[string]interface{}, len(tx.Vin))
+	for i, in := range tx.Vin {
+		vin[i] = map[string]interface{}{
+			"txid":      hex.EncodeToString(in.Txid),
+			"vout":      in.Vout,
+			"scriptSig": hex.EncodeToString(in.Signature),
+		}
+	}
+
+	vout := make([]map[string]interface{}, len(tx.Vout))
+	for i, out := range tx.Vout {
+		vout[i] = map[string]interface{}{
+			"value":        out.Value,
+			"n":            i,
+			"scriptPubKey": hex.EncodeToString(out.PubKeyHash),
+		}
+	}
+
+	return map[string]interface{}{
+		"txid":      hex.EncodeToString(tx.ID),
+		"blockhash": hex.EncodeToString(blockHash),
+		"vin":       vin,
+		"vout":      vout,
+	}
+}
+
+type sendRawTransactionParams struct {
+	Hex string `json:"hex"`
+}
+
+// rpcSendRawTransaction implements sendrawtransaction: it deserializes
+// and verifies the transaction, adds it to the mempool, and gossips it
+// to known peers.
+func (s *Server) rpcSendRawTransaction(params json.RawMessage) (result interface{}, rpcErr *jsonrpcError) {
+	var p sendRawTransactionParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &jsonrpcError{jsonrpcInvalidParams, "invalid params"}
+	}
+
+	raw, err := hex.DecodeString(p.Hex)
+	if err != nil {
+		return nil, &jsonrpcError{jsonrpcInvalidParams, "invalid hex"}
+	}
+
+	tx, err := DeserializeTransaction(raw)
+	if err != nil {
+		return nil, &jsonrpcError{jsonrpcInvalidParams, "invalid transaction"}
+	}
+
+	if !s.verifyTransactionSafely(tx) {
+		return nil, &jsonrpcError{jsonrpcInvalidParams, "transaction failed verification"}
+	}
+
+	txID := hex.EncodeToString(tx.ID)
+	s.memPool[txID] = *tx
+
+	for _, node := range s.knownNodes {
+		if node.Address != s.nodeAddress {
+			s.sendInv(node.Address, "tx", [][]byte{tx.ID})
+		}
+	}
+
+	return txID, nil
+}
+
+// verifyTransactionSafely calls VerifyTransaction, recovering if it
+// panics. VerifyTransaction calls log.Panic when tx references a
+// previous transaction it can't find, and sendrawtransaction is the
+// first RPC method to pass attacker-controlled transaction bytes
+// straight to it, so a malformed input must not take the whole daemon
+// down.
+func (s *Server) verifyTransactionSafely(tx *Transaction) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[GCRPC] Recovered from panic verifying transaction: %v", r)
+			ok = false
+		}
+	}()
+
+	return s.db.VerifyTransaction(tx)
+}
+
+type getBlockParams struct {
+	Hash    string `json:"hash"`
+	Verbose bool   `json:"verbose"`
+}
+
+// rpcGetBlock implements getblock, returning either the hex-encoded
+// serialized block or a decoded summary.
+func (s *Server) rpcGetBlock(params json.RawMessage) (interface{}, *jsonrpcError) {
+	var p getBlockParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &jsonrpcError{jsonrpcInvalidParams, "invalid params"}
+	}
+
+	hash, err := hex.DecodeString(p.Hash)
+	if err != nil {
+		return nil, &jsonrpcError{jsonrpcInvalidParams, "invalid hash"}
+	}
+
+	block, err := s.db.GetBlock(hash)
+	if err != nil {
+		return nil, &jsonrpcError{jsonrpcInvalidParams, "block not found"}
+	}
+
+	serialized, err := block.SerializeBlock()
+	if err != nil {
+		return nil, &jsonrpcError{jsonrpcInternalError, err.Error()}
+	}
+
+	if !p.Verbose {
+		return hex.EncodeToString(serialized), nil
+	}
+
+	txIDs := make([]string, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		txIDs[i] = hex.EncodeToString(tx.ID)
+	}
+
+	return map[string]interface{}{
+		"hash":     hex.EncodeToString(block.Hash),
+		"prevhash": hex.EncodeToString(block.PrevBlockHash),
+		"tx":       txIDs,
+	}, nil
+}
+
+// rpcGetBlockHash implements getblockhash.
+func (s *Server) rpcGetBlockHash(params json.RawMessage) (interface{}, *jsonrpcError) {
+	var p struct {
+		Height int `json:"height"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &jsonrpcError{jsonrpcInvalidParams, "invalid params"}
+	}
+
+	hash, err := s.db.GetBlockHashAtHeight(p.Height)
+	if err != nil {
+		return nil, &jsonrpcError{jsonrpcInvalidParams, err.Error()}
+	}
+
+	return hex.EncodeToString(hash), nil
+}
+
+// rpcGetBlockCount implements getblockcount.
+func (s *Server) rpcGetBlockCount() (interface{}, *jsonrpcError) {
+	return s.db.Height(), nil
+}
+
+// rpcGetMempoolInfo implements getmempoolinfo.
+func (s *Server) rpcGetMempoolInfo() (interface{}, *jsonrpcError) {
+	return map[string]interface{}{"size": len(s.memPool)}, nil
+}
+
+// rpcGetBestBlockHash implements getbestblockhash.
+func (s *Server) rpcGetBestBlockHash() (interface{}, *jsonrpcError) {
+	return hex.EncodeToString(s.db.tip), nil
+}
@@ -0,0 +1,150 @@
+package gcd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
+
+// merkleLevel hashes pairs of nodes in the current level to build the
+// next level up, duplicating the last node when the level has an odd
+// count.
+func merkleLevel(level [][]byte) [][]byte {
+	if len(level)%2 != 0 {
+		level = append(level, level[len(level)-1])
+	}
+
+	next := make([][]byte, 0, len(level)/2)
+	for i := 0; i < len(level); i += 2 {
+		hash := sha256.Sum256(append(append([]byte{}, level[i]...), level[i+1]...))
+		next = append(next, hash[:])
+	}
+
+	return next
+}
+
+// leafHashes returns the sha256(tx.ID) leaves of the block's Merkle
+// tree, in transaction order.
+func (b *Block) leafHashes() [][]byte {
+	leaves := make([][]byte, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		hash := sha256.Sum256(tx.ID)
+		leaves[i] = hash[:]
+	}
+
+	return leaves
+}
+
+// MerkleRoot computes the root of the Merkle tree built over the
+// block's transactions. handleTxProof uses it to self-verify every
+// path it serves.
+//
+// KNOWN GAP: this is not yet wired into the block's proof-of-work hash.
+// That requires changing what NewBlock/SetHash commit to, and that
+// code lives outside this package and isn't present in this tree, so
+// it could not be done here. Until it is, a full node could still
+// alter a confirmed block's transactions without invalidating the
+// block's accepted hash — the tamper-evidence property this was meant
+// to deliver is only partial: proofs served from this endpoint are
+// internally consistent, but not yet backed by the chain's PoW.
+func (b *Block) MerkleRoot() []byte {
+	level := b.leafHashes()
+	if len(level) == 0 {
+		return nil
+	}
+
+	for len(level) > 1 {
+		level = merkleLevel(level)
+	}
+
+	return level[0]
+}
+
+// MerklePath returns the sibling hashes and left/right flags an SPV
+// client needs to verify that txID is included in the block, without
+// fetching every transaction in it. dirs[i] is true when the running
+// hash is the left operand at that level, i.e. path[i] belongs on the
+// right.
+func (b *Block) MerklePath(txID []byte) ([][]byte, []bool, error) {
+	level := b.leafHashes()
+	if len(level) == 0 {
+		return nil, nil, fmt.Errorf("block has no transactions")
+	}
+
+	index := -1
+	for i, tx := range b.Transactions {
+		if bytes.Equal(tx.ID, txID) {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return nil, nil, fmt.Errorf("transaction %x not found in block", txID)
+	}
+
+	var path [][]byte
+	var dirs []bool
+
+	for len(level) > 1 {
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+
+		if index%2 == 0 {
+			path = append(path, level[index+1])
+			dirs = append(dirs, true)
+		} else {
+			path = append(path, level[index-1])
+			dirs = append(dirs, false)
+		}
+
+		level = merkleLevel(level)
+		index /= 2
+	}
+
+	return path, dirs, nil
+}
+
+// VerifyMerklePath recomputes a Merkle root from txID and the sibling
+// path produced by Block.MerklePath, and reports whether it matches
+// root.
+func VerifyMerklePath(txID, root []byte, path [][]byte, dirs []bool) bool {
+	hash := sha256.Sum256(txID)
+	current := hash[:]
+
+	for i, sibling := range path {
+		var combined []byte
+		if dirs[i] {
+			combined = append(append([]byte{}, current...), sibling...)
+		} else {
+			combined = append(append([]byte{}, sibling...), current...)
+		}
+		next := sha256.Sum256(combined)
+		current = next[:]
+	}
+
+	return bytes.Equal(current, root)
+}
+
+// FindTransactionBlock walks the chain to locate the block containing
+// the transaction with the given ID, returning the block and the
+// transaction's index within it so a Merkle proof can be built.
+func (bc *Blockchain) FindTransactionBlock(txID []byte) (*Block, int, error) {
+	bci := bc.Iterator()
+
+	for {
+		block := bci.Next()
+
+		for i, tx := range block.Transactions {
+			if bytes.Equal(tx.ID, txID) {
+				return block, i, nil
+			}
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return nil, 0, fmt.Errorf("transaction %x not found in chain", txID)
+}
@@ -1,7 +1,9 @@
 package gcd
 
 import (
+	"encoding/gob"
 	"encoding/hex"
+	"encoding/json"
 	"io/ioutil"
 	"log"
 	"net"
@@ -22,6 +24,7 @@ const (
 	protocol            = "tcp"
 	nodeVersion         = 1
 	commandLength       = 12
+	mempoolFile         = "mempool.dat"
 )
 
 // Server is the structure which defines the Gophercoin
@@ -40,6 +43,10 @@ type Server struct {
 	memPool         map[string]Transaction
 	miningAddress   string
 	miningTxs       bool
+	blockTree       *BlockTree
+
+	listener  net.Listener
+	rpcServer *http.Server
 
 	wg *sync.WaitGroup
 
@@ -56,13 +63,13 @@ func (s *Server) StartServer() {
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
-		log.Printf("[GCD] Catching signal, terminating gracefully.")
-		if s.wallet != nil {
-			s.wallet.SaveToFile()
-		}
-
-		os.Exit(1)
+		log.Printf("[GCD] Catching signal, shutting down gracefully.")
+		s.Stop()
+		os.Exit(0)
 	}()
+
+	s.loadMempool()
+
 	// create a listener on TCP port
 	var lis net.Listener
 
@@ -83,6 +90,12 @@ func (s *Server) StartServer() {
 		lis = lst
 	}
 
+	s.listener = lis
+	go func() {
+		<-s.quitChan
+		s.listener.Close()
+	}()
+
 	log.Printf("[GCD] PeerServer listening on port %s", s.nodeAddress)
 
 	if len(s.knownNodes) > 0 {
@@ -95,10 +108,16 @@ func (s *Server) StartServer() {
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
-			log.Panic(err)
+			select {
+			case <-s.quitChan:
+				log.Printf("[GCD] PeerServer listener closed, stopping.")
+				return
+			default:
+				log.Panic(err)
+			}
 		}
-		go s.handleConnection(conn)
 		s.wg.Add(1)
+		go s.handleConnection(conn)
 	}
 
 }
@@ -113,7 +132,7 @@ func (s *Server) StartMiner() {
 		select {
 		case <-s.quitChan:
 			log.Printf("[GCMNR] Received stop signal")
-			break
+			return
 		case msg := <-s.minerChan:
 			log.Printf("[GCMNR] Received tx with ID %v", msg)
 
@@ -145,6 +164,104 @@ func (s *Server) StartMiner() {
 
 }
 
+// Stop shuts the daemon down gracefully: it closes quitChan so the peer
+// listener, the miner loop and the time-adjustment loop all stop
+// accepting new work, drains pending sends on nodeServChan and
+// minerChan (timeChan is not drained), waits for a
+// mining run and every tracked goroutine to finish, persists the
+// mempool to mempoolFile, and only then closes the bolt DB. It does not
+// call os.Exit itself, so the whole daemon lifecycle can be exercised
+// from tests; callers driving a real process should exit after it
+// returns.
+func (s *Server) Stop() {
+	close(s.quitChan)
+
+	draining := true
+	for draining {
+		select {
+		case <-s.nodeServChan:
+		case <-s.minerChan:
+		default:
+			draining = false
+		}
+	}
+
+	for s.miningTxs {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	s.wg.Wait()
+
+	if err := s.saveMempool(); err != nil {
+		log.Printf("[GCD] Error saving mempool: %v", err)
+	}
+
+	if s.wallet != nil {
+		s.wallet.SaveToFile()
+	}
+
+	if s.db != nil && s.db.db != nil {
+		if err := s.db.db.Close(); err != nil {
+			log.Printf("[GCD] Error closing database: %v", err)
+		}
+	}
+}
+
+// saveMempool gob-encodes the in-memory mempool to mempoolFile so
+// unconfirmed transactions survive a restart.
+func (s *Server) saveMempool() error {
+	f, err := os.Create(mempoolFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return gob.NewEncoder(f).Encode(s.memPool)
+}
+
+// loadMempool reloads mempoolFile, if present, and re-verifies each
+// transaction against the current UTXO set, discarding any whose
+// inputs have since been spent.
+func (s *Server) loadMempool() {
+	f, err := os.Open(mempoolFile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var pool map[string]Transaction
+	if err := gob.NewDecoder(f).Decode(&pool); err != nil {
+		log.Printf("[GCD] Error decoding %s: %v", mempoolFile, err)
+		return
+	}
+
+	for id, tx := range pool {
+		t := tx
+		if !s.db.VerifyTransaction(&t) {
+			continue
+		}
+
+		spent := false
+		if !t.IsCoinbase() {
+			for _, vin := range t.Vin {
+				if !s.utxoSet.IsUnspent(vin.Txid, vin.Vout) {
+					spent = true
+					break
+				}
+			}
+		}
+		if spent {
+			continue
+		}
+
+		s.memPool[id] = t
+	}
+
+	if err := os.Remove(mempoolFile); err != nil {
+		log.Printf("[GCD] Error removing %s: %v", mempoolFile, err)
+	}
+}
+
 func getExternalAddress() string {
 	resp, err := http.Get("http://myexternalip.com/raw")
 	if err != nil {
@@ -188,6 +305,12 @@ func (s *Server) mineTxs() {
 
 	newBlock := s.db.MineBlock(txs)
 	s.utxoSet.Reindex()
+	if err := s.db.indexBlockTransactions(newBlock); err != nil {
+		log.Printf("[GCMNR] Error updating tx index: %v", err)
+	}
+	if err := s.AddBlock(newBlock); err != nil {
+		log.Printf("[GCMNR] Error updating block tree: %v", err)
+	}
 
 	log.Println("[GCMNR] New block is mined!")
 
@@ -207,6 +330,12 @@ func (s *Server) timeAdjustment() {
 	defer s.wg.Done()
 
 	for {
+		select {
+		case <-s.quitChan:
+			return
+		default:
+		}
+
 		if !s.miningTxs {
 			if s.db != nil {
 				tip := s.db.tip
@@ -233,6 +362,57 @@ func (s *Server) timeAdjustment() {
 
 }
 
+// txProofResponse is the JSON body returned by GET /tx/{txid}/proof.
+type txProofResponse struct {
+	BlockHash string   `json:"blockhash"`
+	Index     int      `json:"index"`
+	Path      []string `json:"path"`
+	Dirs      []bool   `json:"dirs"`
+}
+
+// handleTxProof serves GET /tx/{txid}/proof so SPV/light clients can
+// verify a transaction's inclusion in a block without downloading it.
+func (s *Server) handleTxProof(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	txID, err := hex.DecodeString(vars["txid"])
+	if err != nil {
+		http.Error(w, "invalid txid", http.StatusBadRequest)
+		return
+	}
+
+	block, index, err := s.db.FindTransactionBlock(txID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	path, dirs, err := block.MerklePath(txID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !VerifyMerklePath(txID, block.MerkleRoot(), path, dirs) {
+		http.Error(w, "computed merkle path does not match block root", http.StatusInternalServerError)
+		return
+	}
+
+	resp := txProofResponse{
+		BlockHash: hex.EncodeToString(block.Hash),
+		Index:     index,
+		Path:      make([]string, len(path)),
+		Dirs:      dirs,
+	}
+	for i, sibling := range path {
+		resp.Path[i] = hex.EncodeToString(sibling)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("[GCD] Error encoding tx proof response: %v", err)
+	}
+}
+
 func (s *Server) timeSinceLastBlock() float64 {
 	tip := s.db.tip
 	block, err := s.db.GetBlock(tip)
@@ -0,0 +1,117 @@
+package gcd
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+const txIndexBucket = "txindex"
+
+// buildTxIndex populates the txindex bucket mapping each transaction ID
+// to the hash of the block containing it, so getrawtransaction can look
+// transactions up in O(1) instead of scanning the chain.
+func (bc *Blockchain) buildTxIndex() error {
+	return bc.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(txIndexBucket)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+
+		b, err := tx.CreateBucket([]byte(txIndexBucket))
+		if err != nil {
+			return err
+		}
+
+		bci := bc.Iterator()
+		for {
+			block := bci.Next()
+
+			for _, transaction := range block.Transactions {
+				if err := b.Put(transaction.ID, block.Hash); err != nil {
+					return err
+				}
+			}
+
+			if len(block.PrevBlockHash) == 0 {
+				break
+			}
+		}
+
+		return nil
+	})
+}
+
+// indexBlockTransactions records txindex entries for a single newly
+// applied block, called alongside UTXOSet.Update/Reindex so the index
+// never needs a full rebuild after the initial buildTxIndex.
+func (bc *Blockchain) indexBlockTransactions(block *Block) error {
+	return bc.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(txIndexBucket))
+
+		for _, transaction := range block.Transactions {
+			if err := b.Put(transaction.ID, block.Hash); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// LookupTxBlock returns the hash of the block containing txID, read
+// from the txindex bucket in O(1) rather than scanning the chain.
+func (bc *Blockchain) LookupTxBlock(txID []byte) ([]byte, error) {
+	var hash []byte
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(txIndexBucket))
+		v := b.Get(txID)
+		if v == nil {
+			return fmt.Errorf("transaction %x not indexed", txID)
+		}
+		hash = append([]byte{}, v...)
+		return nil
+	})
+
+	return hash, err
+}
+
+// Height returns the height of the active branch's tip, counted back
+// from the tip to genesis: the number of blocks after genesis, so a
+// chain holding only the genesis block has height 0.
+func (bc *Blockchain) Height() int {
+	height := 0
+	bci := bc.Iterator()
+
+	for {
+		block := bci.Next()
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+		height++
+	}
+
+	return height
+}
+
+// GetBlockHashAtHeight walks back from the tip to find the hash of the
+// block at the given height.
+func (bc *Blockchain) GetBlockHashAtHeight(height int) ([]byte, error) {
+	bci := bc.Iterator()
+	current := bc.Height()
+
+	for {
+		block := bci.Next()
+
+		if current == height {
+			return block.Hash, nil
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+		current--
+	}
+
+	return nil, fmt.Errorf("no block at height %d", height)
+}
@@ -0,0 +1,42 @@
+package gcd
+
+import "github.com/boltdb/bolt"
+
+// IsUnspent reports whether output vout of transaction txID still has
+// an entry in the chainstate bucket, i.e. it hasn't been consumed by
+// any confirmed block. loadMempool uses this to drop reloaded
+// transactions that would otherwise be readmitted as double-spends.
+func (u UTXOSet) IsUnspent(txID []byte, vout int) bool {
+	unspent := false
+
+	err := u.Blockchain.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		if b == nil {
+			return nil
+		}
+
+		data := b.Get(txID)
+		if data == nil {
+			return nil
+		}
+
+		outs, err := DeserializeOutputs(data)
+		if err != nil {
+			return err
+		}
+
+		for idx := range outs.Outputs {
+			if idx == vout {
+				unspent = true
+				break
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false
+	}
+
+	return unspent
+}
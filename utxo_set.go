@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"log"
+
+	"github.com/boltdb/bolt"
+)
+
+const utxoBucket = "chainstate"
+
+// UTXOSet represents the UTXO set backed by a persistent bolt bucket
+// keyed by txid, so wallet queries read a small indexed bucket instead
+// of scanning the whole chain on every call.
+type UTXOSet struct {
+	Blockchain *Blockchain
+}
+
+// TXOutputs is the serializable collection of outputs stored under a
+// single txid key in the chainstate bucket.
+type TXOutputs struct {
+	Outputs []TXOutput
+}
+
+// Serialize gob-encodes outs for storage in the chainstate bucket.
+func (outs TXOutputs) Serialize() ([]byte, error) {
+	var buff bytes.Buffer
+
+	enc := gob.NewEncoder(&buff)
+	if err := enc.Encode(outs); err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
+
+// DeserializeOutputs decodes a TXOutputs value previously produced by
+// Serialize.
+func DeserializeOutputs(data []byte) (TXOutputs, error) {
+	var outputs TXOutputs
+
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&outputs); err != nil {
+		return outputs, err
+	}
+
+	return outputs, nil
+}
+
+// Reindex rebuilds the chainstate bucket from genesis by recomputing
+// every unspent transaction output across the full chain.
+func (u UTXOSet) Reindex() {
+	db := u.Blockchain.db
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket([]byte(utxoBucket))
+		if err != nil && err != bolt.ErrBucketNotFound {
+			log.Panic(err)
+		}
+
+		_, err = tx.CreateBucket([]byte(utxoBucket))
+		if err != nil {
+			log.Panic(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	UTXO := u.Blockchain.FindAllUTXO()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+
+		for txID, outs := range UTXO {
+			key, err := hex.DecodeString(txID)
+			if err != nil {
+				log.Panic(err)
+			}
+
+			serialized, err := outs.Serialize()
+			if err != nil {
+				log.Panic(err)
+			}
+
+			err = b.Put(key, serialized)
+			if err != nil {
+				log.Panic(err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// Update applies the effects of a newly mined or received block onto
+// the chainstate bucket: it removes outputs consumed by the block's
+// inputs and inserts the outputs it creates, so the bucket never needs
+// a full rescan after the initial Reindex.
+func (u UTXOSet) Update(block *Block) {
+	db := u.Blockchain.db
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(utxoBucket))
+		if err != nil {
+			log.Panic(err)
+		}
+
+		for _, transaction := range block.Transactions {
+			if transaction.IsCoinbase() == false {
+				for _, vin := range transaction.Vin {
+					updatedOuts := TXOutputs{}
+					outsBytes := b.Get(vin.Txid)
+					outs, err := DeserializeOutputs(outsBytes)
+					if err != nil {
+						log.Panic(err)
+					}
+
+					for outIdx, out := range outs.Outputs {
+						if outIdx != vin.Vout {
+							updatedOuts.Outputs = append(updatedOuts.Outputs, out)
+						}
+					}
+
+					if len(updatedOuts.Outputs) == 0 {
+						err := b.Delete(vin.Txid)
+						if err != nil {
+							log.Panic(err)
+						}
+					} else {
+						serialized, err := updatedOuts.Serialize()
+						if err != nil {
+							log.Panic(err)
+						}
+						err = b.Put(vin.Txid, serialized)
+						if err != nil {
+							log.Panic(err)
+						}
+					}
+				}
+			}
+
+			newOutputs := TXOutputs{}
+			newOutputs.Outputs = append(newOutputs.Outputs, transaction.Vout...)
+
+			serialized, err := newOutputs.Serialize()
+			if err != nil {
+				log.Panic(err)
+			}
+
+			err = b.Put(transaction.ID, serialized)
+			if err != nil {
+				log.Panic(err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// FindSpendableOutputs reads the chainstate bucket via cursor iteration
+// to find enough unspent outputs belonging to address to cover amount.
+func (u UTXOSet) FindSpendableOutputs(address string, amount int) (int, map[string][]int) {
+	unspentOutputs := make(map[string][]int)
+	accumulated := 0
+	db := u.Blockchain.db
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			txID := hex.EncodeToString(k)
+			outs, err := DeserializeOutputs(v)
+			if err != nil {
+				log.Panic(err)
+			}
+
+			for outIdx, out := range outs.Outputs {
+				if out.CanBeUnlockedWith(address) && accumulated < amount {
+					accumulated += out.Value
+					unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return accumulated, unspentOutputs
+}
+
+// FindUTXO reads the chainstate bucket via cursor iteration to find all
+// unspent outputs belonging to address.
+func (u UTXOSet) FindUTXO(address string) []TXOutput {
+	var UTXOs []TXOutput
+	db := u.Blockchain.db
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			outs, err := DeserializeOutputs(v)
+			if err != nil {
+				log.Panic(err)
+			}
+
+			for _, out := range outs.Outputs {
+				if out.CanBeUnlockedWith(address) {
+					UTXOs = append(UTXOs, out)
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return UTXOs
+}
+
+// CountTransactions returns the number of transactions currently
+// tracked in the chainstate bucket, for chain metrics.
+func (u UTXOSet) CountTransactions() int {
+	db := u.Blockchain.db
+	counter := 0
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		c := b.Cursor()
+
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			counter++
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return counter
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// TestUTXOSetReindexMatchesIncrementalUpdate verifies that rebuilding
+// the chainstate bucket from genesis via Reindex produces the exact
+// same bucket contents as applying the same block via the incremental
+// Update path, so the fast path introduced to replace full-chain scans
+// can be trusted to agree with a full rescan.
+func TestUTXOSetReindexMatchesIncrementalUpdate(t *testing.T) {
+	os.Remove(dbFile)
+	defer os.Remove(dbFile)
+
+	address := "1JqjWCAKvGkDJ5hWozLhd8mVCYyYb3pbh2"
+	bc := CreateBlockchain(address)
+	defer bc.db.Close()
+
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatalf("GetBlock(genesis): %v", err)
+	}
+
+	utxoSet := UTXOSet{bc}
+
+	utxoSet.Update(genesis)
+	incremental := dumpChainstate(t, bc)
+
+	utxoSet.Reindex()
+	reindexed := dumpChainstate(t, bc)
+
+	if !reflect.DeepEqual(incremental, reindexed) {
+		t.Fatalf("incremental update and reindex disagree:\nincremental: %#v\nreindexed:   %#v", incremental, reindexed)
+	}
+}
+
+// TestUTXOSetReindexMatchesIncrementalUpdateAcrossSpend extends the
+// above comparison across a second block that spends the genesis
+// coinbase output, so the removal branch in UTXOSet.Update and the
+// spentTXOs bookkeeping in Blockchain.FindAllUTXO are both exercised
+// rather than only the append-only genesis case.
+func TestUTXOSetReindexMatchesIncrementalUpdateAcrossSpend(t *testing.T) {
+	os.Remove(dbFile)
+	defer os.Remove(dbFile)
+
+	address := "1JqjWCAKvGkDJ5hWozLhd8mVCYyYb3pbh2"
+	recipient := "13hQVEbyLroAjTR9Q714ridgK9AtBQ5DQ9"
+
+	bc := CreateBlockchain(address)
+	defer bc.db.Close()
+
+	genesis, err := bc.GetBlock(bc.tip)
+	if err != nil {
+		t.Fatalf("GetBlock(genesis): %v", err)
+	}
+
+	utxoSet := UTXOSet{bc}
+	utxoSet.Update(genesis)
+
+	coinbase := genesis.Transactions[0]
+	spend := &Transaction{
+		ID: []byte("test-spend-tx-0001"),
+		Vin: []TXInput{
+			{Txid: coinbase.ID, Vout: 0},
+		},
+		Vout: []TXOutput{
+			{Value: 5, PubKeyHash: []byte(recipient)},
+		},
+	}
+
+	bc.MineBlock([]*Transaction{spend})
+	incremental := dumpChainstate(t, bc)
+
+	utxoSet.Reindex()
+	reindexed := dumpChainstate(t, bc)
+
+	if !reflect.DeepEqual(incremental, reindexed) {
+		t.Fatalf("incremental update and reindex disagree after a spend:\nincremental: %#v\nreindexed:   %#v", incremental, reindexed)
+	}
+
+	if _, stillPresent := incremental[string(coinbase.ID)]; stillPresent {
+		t.Fatalf("expected the fully-spent genesis coinbase output to be removed from the chainstate bucket")
+	}
+}
+
+// dumpChainstate reads every key/value currently stored in the
+// chainstate bucket, so Reindex and Update can be compared byte for
+// byte.
+func dumpChainstate(t *testing.T, bc *Blockchain) map[string][]byte {
+	t.Helper()
+
+	dump := make(map[string][]byte)
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			dump[string(k)] = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("reading chainstate bucket: %v", err)
+	}
+
+	return dump
+}